@@ -0,0 +1,149 @@
+package quobar
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgbutil"
+	"github.com/BurntSushi/xgbutil/ewmh"
+	"github.com/BurntSushi/xgbutil/xgraphics"
+	"github.com/BurntSushi/xgbutil/xwindow"
+)
+
+// bar is one status bar window, docked to a single output. Main keeps
+// one bar per connected (and allowed) output, tearing them down and
+// spawning new ones as monitors come and go.
+type bar struct {
+	output  *outputInfo
+	win     *xwindow.Window
+	stop    chan struct{}
+	drawers []Drawer
+	width   int
+	height  int
+	hub     *redrawHub
+	sub     *redrawSubscription
+}
+
+// newBar creates and maps the dock window for info, then starts its
+// redraw loop and mouse-click dispatch in the background. Errors from
+// either are reported on errCh, same as the rest of Main's error
+// handling. hub is the redrawHub shared by every bar in this Main
+// invocation, so that drawers visible on several outputs redraw on
+// all of them rather than just one.
+func newBar(Xu *xgbutil.XUtil, screen *xproto.ScreenInfo, state *State, info *outputInfo, drawers []Drawer, hub *redrawHub, errCh chan<- error) (*bar, error) {
+	// Each output has its own pixel density, so the bar's height (and
+	// anything DPI-derived, like State.Font) must be computed from
+	// this output's own resolution, not state.Resolution, which is
+	// only representative of whichever output Main started on.
+	resolution := NewResolution(info.screenHeightInPixels, info.screenHeightInMillimeters)
+	height := resolution.Pixels(state.Config.HeightMillimeters)
+	geom := barGeometry(info, state.Config.Position, state.Config.Margin, height)
+
+	win, err := xwindow.Generate(Xu)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create X11 window: %v", err)
+	}
+	win.Create(screen.Root,
+		geom.Min.X, geom.Min.Y, geom.Dx(), geom.Dy(),
+		xproto.CwBackPixel, 0xffffff)
+
+	netWmState := "_NET_WM_STATE_BELOW"
+	stackMode := xproto.StackModeBelow
+	if state.Config.Position == PositionFloating {
+		// a floating bar reserves no strut, so it needs to stay above
+		// normal windows to remain visible where the user put it
+		netWmState = "_NET_WM_STATE_ABOVE"
+		stackMode = xproto.StackModeAbove
+	}
+	win.Stack(stackMode)
+
+	// http://standards.freedesktop.org/wm-spec/wm-spec-latest.html
+
+	if err := ewmh.WmWindowTypeSet(Xu, win.Id, []string{"_NET_WM_WINDOW_TYPE_DOCK"}); err != nil {
+		return nil, fmt.Errorf("cannot set window to be a dock: %v", err)
+	}
+
+	if err := ewmh.WmPidSet(Xu, win.Id, uint(os.Getpid())); err != nil {
+		return nil, fmt.Errorf("cannot set pid: %v", err)
+	}
+
+	if err := ewmh.WmStateReq(Xu, win.Id, ewmh.StateAdd, netWmState); err != nil {
+		return nil, fmt.Errorf("cannot set window stacking state: %v", err)
+	}
+
+	if err := ewmh.WmNameSet(Xu, win.Id, fmt.Sprintf("quobar (%s)", info.name)); err != nil {
+		return nil, fmt.Errorf("cannot set window title: %v", err)
+	}
+	win.Map()
+
+	if err := ewmh.WmStrutPartialSet(Xu, win.Id, barStrut(screen, state.Config.Position, geom)); err != nil {
+		return nil, fmt.Errorf("setting struts: %v", err)
+	}
+
+	b := &bar{
+		output:  info,
+		win:     win,
+		stop:    make(chan struct{}),
+		drawers: drawers,
+		width:   geom.Dx(),
+		height:  geom.Dy(),
+		hub:     hub,
+		sub:     hub.subscribe(),
+	}
+
+	if err := bindClicks(Xu, b, errCh); err != nil {
+		return nil, fmt.Errorf("binding mouse clicks: %v", err)
+	}
+
+	go func() {
+		ximg := xgraphics.New(Xu, image.Rect(0, 0, geom.Dx(), geom.Dy()))
+		defer ximg.Destroy()
+
+		draw.Draw(ximg, ximg.Bounds(), image.NewUniform(state.Config.Background), image.ZP, draw.Src)
+		if err := drawAll(ximg, drawers); err != nil {
+			errCh <- fmt.Errorf("draw error on output %v: %v", info.name, err)
+			return
+		}
+		if err := ximg.XSurfaceSet(win.Id); err != nil {
+			errCh <- fmt.Errorf("XSurfaceSet: %v", err)
+			return
+		}
+		ximg.XDraw()
+		ximg.XPaint(win.Id)
+
+		redraw := newRedrawScheduler(b.sub, refreshRate(state.Config.MaxRefreshRate), b.stop)
+		for {
+			select {
+			case <-b.stop:
+				return
+			case dirty := <-redraw:
+				rects := make([]image.Rectangle, 0, len(dirty))
+				for idx := range dirty {
+					if err := drawOne(ximg, drawers, idx); err != nil {
+						errCh <- fmt.Errorf("draw error on output %v: %v", info.name, err)
+						return
+					}
+					rects = append(rects, drawerRect(ximg.Bounds(), len(drawers), idx))
+				}
+				if len(rects) == 0 {
+					continue
+				}
+				ximg.XDraw()
+				ximg.XPaintRects(win.Id, rects...)
+			}
+		}
+	}()
+
+	return b, nil
+}
+
+// Close tears down the bar's redraw loop and destroys its window, in
+// response to its output being unplugged or reconfigured.
+func (b *bar) Close() {
+	close(b.stop)
+	b.hub.unsubscribe(b.sub)
+	b.win.Destroy()
+}
@@ -1,22 +1,15 @@
 package quobar
 
 import (
-	"errors"
 	"fmt"
 	"image"
 	"image/draw"
-	"os"
 	"sort"
-	"time"
 
-	"github.com/BurntSushi/xgb"
 	"github.com/BurntSushi/xgb/randr"
 	"github.com/BurntSushi/xgb/xproto"
 	"github.com/BurntSushi/xgbutil"
-	"github.com/BurntSushi/xgbutil/ewmh"
 	"github.com/BurntSushi/xgbutil/xevent"
-	"github.com/BurntSushi/xgbutil/xgraphics"
-	"github.com/BurntSushi/xgbutil/xwindow"
 )
 
 type Image interface {
@@ -27,96 +20,58 @@ type Image interface {
 	SubImage(r image.Rectangle) image.Image
 }
 
+// drawerRect returns the sub-rectangle of bounds owned by drawer idx
+// out of n equally-sized, left-to-right slots. drawAll and the
+// event-driven redraw scheduler must agree on this layout so that a
+// single plugin can be repainted without disturbing its neighbours.
+func drawerRect(bounds image.Rectangle, n, idx int) image.Rectangle {
+	offset := image.Pt(bounds.Max.X, 0).Div(n)
+	shape := image.Rect(0, 0, offset.X, bounds.Max.Y)
+	return shape.Add(offset.Mul(idx))
+}
+
 func drawAll(img Image, drawers []Drawer) error {
-	offset := image.Pt(img.Bounds().Max.X, 0).Div(len(drawers))
-	shape := image.Rect(0, 0, offset.X, img.Bounds().Max.Y)
-	for idx, drawer := range drawers {
-		sub := img.SubImage(shape.Add(offset.Mul(idx)))
-		if sub == nil {
-			return fmt.Errorf("buggy shape math: shape=%v offset=%v idx=%v", shape, offset, idx)
-		}
-		dr, ok := sub.(draw.Image)
-		if !ok {
-			return fmt.Errorf("drawer subimage is not drawable: %v", drawer)
-		}
-		if err := drawer.Draw(dr); err != nil {
-			return fmt.Errorf("drawer failed: %v", err)
+	for idx := range drawers {
+		if err := drawOne(img, drawers, idx); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-func stopMainloop(xu *xgbutil.XUtil, event interface{}) bool {
-	xevent.Quit(xu)
-	return true
-}
-
-type outputInfo struct {
-	screenHeightInPixels      uint16
-	screenWidthInPixels       uint16
-	screenHeightInMillimeters uint32
-}
-
-var errUnplugged = errors.New("display is not connected")
-
-func getOutput(X *xgb.Conn, configTimestamp xproto.Timestamp, output randr.Output) (*outputInfo, error) {
-	randrOutput, err := randr.GetOutputInfo(X, output, configTimestamp).Reply()
-	if err != nil {
-		return nil, fmt.Errorf("cannot get RandR screen resources: %v", err)
+// drawOne redraws the single drawer at idx into its owned sub-rectangle
+// of img, leaving the rest of the image untouched.
+func drawOne(img Image, drawers []Drawer, idx int) error {
+	drawer := drawers[idx]
+	rect := drawerRect(img.Bounds(), len(drawers), idx)
+	sub := img.SubImage(rect)
+	if sub == nil {
+		return fmt.Errorf("buggy shape math: rect=%v idx=%v", rect, idx)
 	}
-
-	// is there a more direct way to detect unplugged monitors?
-	if randrOutput.MmHeight == 0 {
-		return nil, errUnplugged
+	dr, ok := sub.(draw.Image)
+	if !ok {
+		return fmt.Errorf("drawer subimage is not drawable: %v", drawer)
 	}
-
-	randrCrtcInfo, err := randr.GetCrtcInfo(X, randrOutput.Crtc, configTimestamp).Reply()
-	if err != nil {
-		return nil, fmt.Errorf("cannot get RandR monitor info: %v", err)
-	}
-
-	info := &outputInfo{
-		screenHeightInPixels:      randrCrtcInfo.Height,
-		screenWidthInPixels:       randrCrtcInfo.Width,
-		screenHeightInMillimeters: randrOutput.MmHeight,
+	if err := drawer.Draw(dr); err != nil {
+		return fmt.Errorf("drawer failed: %v", err)
 	}
-	return info, nil
+	return nil
 }
 
-func findOutput(X *xgb.Conn, screen *xproto.ScreenInfo) (*outputInfo, error) {
-	randrScreenResources, err := randr.GetScreenResourcesCurrent(X, screen.Root).Reply()
-	if err != nil {
-		return nil, fmt.Errorf("cannot get RandR screen resources: %v", err)
-	}
-
-	outputs := make([]randr.Output, 0, 1+len(randrScreenResources.Outputs))
-
-	randrPrimary, err := randr.GetOutputPrimary(X, screen.Root).Reply()
-	if err != nil {
-		return nil, fmt.Errorf("cannot get RandR primary: %v", err)
-	}
-	if randrPrimary.Output != 0 {
-		outputs = append(outputs, randrPrimary.Output)
-	}
-
-	outputs = append(outputs, randrScreenResources.Outputs...)
-
-	for _, output := range outputs {
-		info, err := getOutput(X, randrScreenResources.ConfigTimestamp, output)
-		if err == errUnplugged {
-			continue
-		}
-		if err != nil {
-			return nil, err
-		}
-		return info, nil
-	}
-	return nil, errors.New("cannot find any plugged-in output")
+func stopMainloop(xu *xgbutil.XUtil, event interface{}) bool {
+	xevent.Quit(xu)
+	return true
 }
 
 // Main runs the main loop for quobar. It is available in library form
 // to keep github.com/tv42/quobar/cmd/quobar short and easy to copy
 // for editing.
+//
+// One bar is created per connected output (restricted to
+// defaultConfig.Outputs when that allowlist is non-empty). When RandR
+// is usable, bars are added, removed, and resized as monitors are
+// plugged, unplugged, or reconfigured; on the Xinerama and
+// root-geometry fallbacks the set of bars is fixed at startup.
 func Main(defaultConfig Config) error {
 	Xu, err := xgbutil.NewConn()
 	if err != nil {
@@ -128,17 +83,28 @@ func Main(defaultConfig Config) error {
 	setup := xproto.Setup(X)
 	screen := setup.DefaultScreen(X)
 
-	if err := randr.Init(X); err != nil {
-		return fmt.Errorf("initializing RandR: %v", err)
+	if err := initInput(Xu); err != nil {
+		return err
 	}
 
-	info, err := findOutput(X, screen)
+	infos, haveRandR, err := discoverOutputs(X, screen, defaultConfig.Outputs)
 	if err != nil {
-		return fmt.Errorf("choosing monitor to display on: %v", err)
+		return fmt.Errorf("choosing monitors to display on: %v", err)
 	}
 
+	if haveRandR {
+		if err := randr.SelectInputChecked(X, screen.Root, randr.NotifyMaskScreenChange).Check(); err != nil {
+			return fmt.Errorf("registering for RandR screen change notifications: %v", err)
+		}
+	}
+
+	// Resolution here is only a representative default for plugin
+	// construction below; it's infos[0]'s and must not be used for
+	// anything output-specific (bar height, font DPI), since those
+	// differ per monitor. newBar computes its own per-output
+	// Resolution instead of trusting this one.
 	state := &State{
-		Resolution: NewResolution(info.screenHeightInPixels, info.screenHeightInMillimeters),
+		Resolution: NewResolution(infos[0].screenHeightInPixels, infos[0].screenHeightInMillimeters),
 		Config:     defaultConfig,
 	}
 	// TODO load config
@@ -155,6 +121,8 @@ func Main(defaultConfig Config) error {
 
 	// TODO feed config to each plugin
 	drawers := make([]Drawer, 0, len(plugins))
+	drawerNames := make([]string, 0, len(plugins))
+	textDrawers := make(map[string]*TextDrawer)
 	for _, name := range pluginNames {
 		p := plugins[name]
 		if !p.first {
@@ -164,80 +132,97 @@ func Main(defaultConfig Config) error {
 		if err != nil {
 			return fmt.Errorf("plugin error: %v", err)
 		}
+		if td, ok := d.(*TextDrawer); ok {
+			textDrawers[name] = td
+		}
 		drawers = append(drawers, d)
+		drawerNames = append(drawerNames, name)
 	}
 
-	// Height of the status bar, in pixels.
-	height := state.Resolution.Pixels(state.Config.HeightMillimeters)
+	// hub fans each drawer's redraw notifications out to every bar
+	// subscribed to it, since drawers is shared by every output's bar
+	// (see bars.go).
+	hub := newRedrawHub(drawers)
 
-	win, err := xwindow.Generate(Xu)
-	if err != nil {
-		return fmt.Errorf("cannot create X11 window: %v", err)
-	}
-	win.Create(screen.Root,
-		0, int(info.screenHeightInPixels)-height,
-		int(info.screenWidthInPixels), height,
-		xproto.CwBackPixel, 0xffffff)
-	win.Stack(xproto.StackModeBelow)
-
-	// http://standards.freedesktop.org/wm-spec/wm-spec-latest.html
+	errCh := make(chan error, 1)
 
-	if err := ewmh.WmWindowTypeSet(Xu, win.Id, []string{"_NET_WM_WINDOW_TYPE_DOCK"}); err != nil {
-		return fmt.Errorf("cannot set window to be a dock: %v", err)
+	if err := bindKeys(Xu, screen, state, errCh); err != nil {
+		return fmt.Errorf("binding keys: %v", err)
 	}
 
-	if err := ewmh.WmPidSet(Xu, win.Id, uint(os.Getpid())); err != nil {
-		return fmt.Errorf("cannot set pid: %v", err)
+	ipc, err := listenIPC(defaultConfig.SocketPath, textDrawers, hub, drawerNames, errCh)
+	if err != nil {
+		return fmt.Errorf("starting control socket: %v", err)
 	}
+	defer ipc.Close()
 
-	if err := ewmh.WmStateReq(Xu, win.Id, ewmh.StateAdd, "_NET_WM_STATE_BELOW"); err != nil {
-		return fmt.Errorf("cannot lower window: %v", err)
+	// Keyed by output name rather than randr.Output: that field is the
+	// zero value for every output when running on the Xinerama or
+	// root-geometry fallback, which would otherwise collide.
+	bars := make(map[string]*bar, len(infos))
+	for _, info := range infos {
+		b, err := newBar(Xu, screen, state, info, drawers, hub, errCh)
+		if err != nil {
+			return fmt.Errorf("creating bar for output %v: %v", info.name, err)
+		}
+		bars[info.name] = b
+	}
+
+	// Hot-plug handling needs RandR's screen-change notifications;
+	// Xinerama and the root-geometry fallback have no equivalent, so
+	// their outputs are fixed for the life of the process.
+	if haveRandR {
+		xevent.ScreenChangeNotifyFun(
+			func(xu *xgbutil.XUtil, ev randr.ScreenChangeNotifyEvent) {
+				infos, err := findOutputs(X, screen, defaultConfig.Outputs)
+				if err != nil {
+					errCh <- fmt.Errorf("re-enumerating outputs after screen change: %v", err)
+					return
+				}
+
+				seen := make(map[string]bool, len(infos))
+				for _, info := range infos {
+					seen[info.name] = true
+
+					if existing, ok := bars[info.name]; ok {
+						if *existing.output == *info {
+							// unchanged, leave the bar running
+							continue
+						}
+						existing.Close()
+					}
+
+					b, err := newBar(Xu, screen, state, info, drawers, hub, errCh)
+					if err != nil {
+						errCh <- fmt.Errorf("spawning bar for output %v: %v", info.name, err)
+						continue
+					}
+					bars[info.name] = b
+				}
+
+				for name, b := range bars {
+					if !seen[name] {
+						b.Close()
+						delete(bars, name)
+					}
+				}
+			},
+		).Connect(Xu, screen.Root)
 	}
 
-	if err := ewmh.WmNameSet(Xu, win.Id, "quobar"); err != nil {
-		return fmt.Errorf("cannot set window title: %v", err)
-	}
-	win.Map()
+	go xevent.Main(Xu)
 
-	if err := ewmh.WmStrutSet(Xu, win.Id, &ewmh.WmStrut{
-		Left:   0,
-		Right:  0,
-		Top:    0,
-		Bottom: uint(height),
-	}); err != nil {
-		return fmt.Errorf("setting struts: %v", err)
+	// xgbutil's quit mechanism is only meant to be used from the same
+	// goroutine where xevent.Main is running (from the callbacks). We'd
+	// really like to say `defer xevent.Quit(Xu)` here, but have to do
+	// this weird thing (and wait for the next event) to be goroutine
+	// safe.
+	//
+	// https://github.com/BurntSushi/xgbutil/issues/9
+	drawErr := <-errCh
+	xevent.HookFun(stopMainloop).Connect(Xu)
+	if drawErr == errQuitRequested {
+		return nil
 	}
-
-	errCh := make(chan error, 1)
-	go func() {
-		// xgbutil's quit mechanism is only meant to be used from the
-		// same goroutine where xevent.Main is running (from the
-		// callbacks). We'd really like to say `defer xevent.Quit(Xu)`
-		// here, but have to do this weird thing (and wait for the
-		// next event) to be goroutine safe.
-		//
-		// https://github.com/BurntSushi/xgbutil/issues/9
-		defer xevent.HookFun(stopMainloop).Connect(Xu)
-		defer close(errCh)
-		ximg := xgraphics.New(Xu, image.Rect(0, 0, int(info.screenWidthInPixels), height))
-		defer ximg.Destroy()
-		for {
-			draw.Draw(ximg, ximg.Bounds(), image.NewUniform(state.Config.Background), image.ZP, draw.Src)
-
-			if err := drawAll(ximg, drawers); err != nil {
-				errCh <- fmt.Errorf("draw error: %v", err)
-				return
-			}
-
-			if err := ximg.XSurfaceSet(win.Id); err != nil {
-				errCh <- fmt.Errorf("XSurfaceSet: %v", err)
-				return
-			}
-			ximg.XDraw()
-			ximg.XPaint(win.Id)
-			time.Sleep(1 * time.Second)
-		}
-	}()
-	go xevent.Main(Xu)
-	return <-errCh
+	return drawErr
 }
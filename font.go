@@ -0,0 +1,92 @@
+package quobar
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	findfont "github.com/flopp/go-findfont"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+)
+
+// fontCacheKey identifies one rendered size of one fontconfig-resolved
+// font, so State.Font can hand out the same face to every caller that
+// asks for it.
+type fontCacheKey struct {
+	name string
+	size float64
+	dpi  float64
+}
+
+var (
+	fontMu    sync.Mutex
+	fontCache = map[string]*truetype.Font{}
+	faceCache = map[fontCacheKey]font.Face{}
+)
+
+// loadFont resolves name through fontconfig and parses the file it
+// points at, caching the result so repeated lookups of the same font
+// name are free after the first.
+func loadFont(name string) (*truetype.Font, error) {
+	fontMu.Lock()
+	defer fontMu.Unlock()
+
+	if f, ok := fontCache[name]; ok {
+		return f, nil
+	}
+
+	path, err := findfont.Find(name)
+	if err != nil {
+		return nil, fmt.Errorf("resolving font %q via fontconfig: %v", name, err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading font file %v: %v", path, err)
+	}
+
+	f, err := truetype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing font file %v: %v", path, err)
+	}
+
+	fontCache[name] = f
+	return f, nil
+}
+
+// Font returns a font.Face for state.Config.Font at the given point
+// size, rendered at the DPI implied by resolution. Callers must pass
+// the Resolution of the particular output they're drawing on, not a
+// single process-wide one: each monitor has its own pixel density,
+// and state.Resolution is only representative of whichever output
+// Main happened to start on. Faces are cached per (font name, size,
+// DPI), so plugins can simply call state.Font from Draw instead of
+// each loading its own font file by absolute path.
+func (state *State) Font(size float64, resolution Resolution) (font.Face, error) {
+	dpi := resolution.DPI()
+	key := fontCacheKey{name: state.Config.Font, size: size, dpi: dpi}
+
+	fontMu.Lock()
+	if face, ok := faceCache[key]; ok {
+		fontMu.Unlock()
+		return face, nil
+	}
+	fontMu.Unlock()
+
+	f, err := loadFont(state.Config.Font)
+	if err != nil {
+		return nil, err
+	}
+
+	face := truetype.NewFace(f, &truetype.Options{
+		Size: size,
+		DPI:  dpi,
+	})
+
+	fontMu.Lock()
+	faceCache[key] = face
+	fontMu.Unlock()
+
+	return face, nil
+}
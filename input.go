@@ -0,0 +1,94 @@
+package quobar
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgbutil"
+	"github.com/BurntSushi/xgbutil/keybind"
+	"github.com/BurntSushi/xgbutil/mousebind"
+	"github.com/BurntSushi/xgbutil/xevent"
+)
+
+// Clickable is an optional interface a Drawer can implement to react
+// to mouse clicks (the scroll wheel arrives as buttons 4 and 5)
+// landing on the sub-rectangle it owns.
+type Clickable interface {
+	Drawer
+	// OnClick is called with the button pressed and the click's
+	// coordinates relative to the drawer's own sub-rectangle, not the
+	// whole bar.
+	OnClick(button xproto.Button, x, y int) error
+}
+
+// initInput must be called once per X connection, before any bar is
+// created or key binding registered.
+func initInput(Xu *xgbutil.XUtil) error {
+	if err := mousebind.Initialize(Xu); err != nil {
+		return fmt.Errorf("initializing mouse bindings: %v", err)
+	}
+	if err := keybind.Initialize(Xu); err != nil {
+		return fmt.Errorf("initializing key bindings: %v", err)
+	}
+	return nil
+}
+
+// bindClicks wires button presses on the bar's window, translating
+// the click's bar-window-relative coordinates into the owning drawer's own
+// sub-rectangle and dispatching to it if it implements Clickable.
+func bindClicks(Xu *xgbutil.XUtil, b *bar, errCh chan<- error) error {
+	return mousebind.ButtonPressFun(
+		func(xu *xgbutil.XUtil, ev xevent.ButtonPressEvent) {
+			if err := b.dispatchClick(ev.Detail, int(ev.EventX), int(ev.EventY)); err != nil {
+				errCh <- fmt.Errorf("click handler failed on output %v: %v", b.output.name, err)
+			}
+		},
+	).Connect(Xu, b.win.Id, "Any", false, true)
+}
+
+// dispatchClick finds which drawer owns (x, y) within the bar and, if
+// it implements Clickable, forwards the click to it with coordinates
+// translated relative to that drawer's own sub-rectangle.
+func (b *bar) dispatchClick(button xproto.Button, x, y int) error {
+	// b.width is the bar's own drawn width (geom.Dx() from newBar), not
+	// the output's full width: Config.Margin.Left/Right shrink the bar
+	// below the output, and drawerRect must agree with the same width
+	// drawAll used or clicks land on the wrong plugin with skewed
+	// coordinates.
+	bounds := image.Rect(0, 0, b.width, b.height)
+	pt := image.Pt(x, y)
+	for idx, d := range b.drawers {
+		rect := drawerRect(bounds, len(b.drawers), idx)
+		if !pt.In(rect) {
+			continue
+		}
+		clickable, ok := d.(Clickable)
+		if !ok {
+			return nil
+		}
+		return clickable.OnClick(button, x-rect.Min.X, y-rect.Min.Y)
+	}
+	return nil
+}
+
+// bindKeys registers every binding in state.Config.KeyBindings on the
+// root window, so plugins can react to global shortcuts and
+// multimedia keys (e.g. XF86AudioRaiseVolume) without owning a window
+// of their own.
+func bindKeys(Xu *xgbutil.XUtil, screen *xproto.ScreenInfo, state *State, errCh chan<- error) error {
+	for key, handler := range state.Config.KeyBindings {
+		key, handler := key, handler
+		err := keybind.KeyPressFun(
+			func(xu *xgbutil.XUtil, ev xevent.KeyPressEvent) {
+				if err := handler(state); err != nil {
+					errCh <- fmt.Errorf("key binding %q failed: %v", key, err)
+				}
+			},
+		).Connect(Xu, screen.Root, key, true)
+		if err != nil {
+			return fmt.Errorf("binding key %q: %v", key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package quobar
+
+import (
+	"image/draw"
+	"testing"
+
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+// clickRecorder is a minimal Clickable for exercising dispatchClick
+// without any X11 state.
+type clickRecorder struct {
+	clicked bool
+	button  xproto.Button
+	x, y    int
+}
+
+func (c *clickRecorder) Draw(img draw.Image) error { return nil }
+
+func (c *clickRecorder) OnClick(button xproto.Button, x, y int) error {
+	c.clicked = true
+	c.button = button
+	c.x, c.y = x, y
+	return nil
+}
+
+func TestDispatchClick(t *testing.T) {
+	// Regression test for the chunk0-6 margin bug: a bar docked with
+	// non-zero left/right margin is narrower than its output, and
+	// dispatchClick must route against the bar's own drawn width
+	// (b.width), not b.output.screenWidthInPixels.
+	left := &clickRecorder{}
+	right := &clickRecorder{}
+	b := &bar{
+		drawers: []Drawer{left, right},
+		width:   100,
+		height:  20,
+	}
+
+	if err := b.dispatchClick(1, 60, 5); err != nil {
+		t.Fatalf("dispatchClick: %v", err)
+	}
+	if left.clicked {
+		t.Errorf("click at x=60 landed on the left drawer, want right")
+	}
+	if !right.clicked {
+		t.Fatalf("click at x=60 did not reach the right drawer")
+	}
+	if right.x != 10 {
+		t.Errorf("right drawer got x=%d, want 10 (60 - rect.Min.X=50)", right.x)
+	}
+}
@@ -0,0 +1,166 @@
+package quobar
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// errQuitRequested is sent on the bar's error channel when a
+// {"quit":true} command arrives on the control socket, so quobar
+// shuts down through Main's existing error-handling path.
+var errQuitRequested = errors.New("quit requested over control socket")
+
+// ipcCommand is one line of the newline-delimited JSON protocol
+// accepted on the control socket: set a TextDrawer's content, ask for
+// a config reload, ask quobar to quit, or subscribe to bar-state
+// events.
+type ipcCommand struct {
+	Plugin    string `json:"plugin,omitempty"`
+	Set       string `json:"set,omitempty"`
+	Reload    bool   `json:"reload,omitempty"`
+	Quit      bool   `json:"quit,omitempty"`
+	Subscribe bool   `json:"subscribe,omitempty"`
+}
+
+// defaultSocketPath returns $XDG_RUNTIME_DIR/quobar.sock, falling
+// back to os.TempDir() when XDG_RUNTIME_DIR isn't set.
+func defaultSocketPath() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "quobar.sock")
+}
+
+// ipcServer is the Unix-domain control socket that lets external
+// scripts and systemd units feed plugin content and control quobar at
+// runtime, mirroring the i3blocks/lemonbar/dwm convention of external
+// status feeders.
+type ipcServer struct {
+	ln net.Listener
+}
+
+// redrawEvent is one line of the newline-delimited JSON stream sent
+// back on a connection after a {"subscribe":true} command: the name
+// of a drawer (see drawerNames) that just requested a redraw.
+type redrawEvent struct {
+	Event  string `json:"event"`
+	Plugin string `json:"plugin"`
+}
+
+// listenIPC opens the control socket at path (defaultSocketPath when
+// path is empty), removing a stale socket file left behind by a
+// previous, uncleanly-terminated run, and starts accepting connections
+// in the background. textDrawers maps plugin name to the live
+// TextDrawer instance a {"plugin":...,"set":...} command should update.
+// hub and drawerNames (parallel to the drawers slice it was built
+// from) let a {"subscribe":true} connection stream redrawEvents back.
+func listenIPC(path string, textDrawers map[string]*TextDrawer, hub *redrawHub, drawerNames []string, errCh chan<- error) (*ipcServer, error) {
+	if path == "" {
+		path = defaultSocketPath()
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("removing stale control socket: %v", err)
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("listening on control socket %v: %v", path, err)
+	}
+
+	s := &ipcServer{ln: ln}
+	go s.acceptLoop(textDrawers, hub, drawerNames, errCh)
+	return s, nil
+}
+
+func (s *ipcServer) acceptLoop(textDrawers map[string]*TextDrawer, hub *redrawHub, drawerNames []string, errCh chan<- error) {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			// listener closed, e.g. by Close
+			return
+		}
+		go s.handleConn(conn, textDrawers, hub, drawerNames, errCh)
+	}
+}
+
+func (s *ipcServer) handleConn(conn net.Conn, textDrawers map[string]*TextDrawer, hub *redrawHub, drawerNames []string, errCh chan<- error) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var cmd ipcCommand
+		if err := json.Unmarshal(scanner.Bytes(), &cmd); err != nil {
+			fmt.Fprintf(conn, "error: invalid command: %v\n", err)
+			continue
+		}
+
+		switch {
+		case cmd.Quit:
+			errCh <- errQuitRequested
+			return
+		case cmd.Reload:
+			// Accepted and ignored: Config is not reloaded and
+			// nothing is written back on the connection.
+		case cmd.Subscribe:
+			s.streamEvents(conn, hub, drawerNames)
+			return
+		case cmd.Plugin != "":
+			d, ok := textDrawers[cmd.Plugin]
+			if !ok {
+				fmt.Fprintf(conn, "error: unknown text plugin %q\n", cmd.Plugin)
+				continue
+			}
+			d.Set(cmd.Set)
+		}
+	}
+}
+
+// streamEvents takes over conn for the rest of its lifetime, writing
+// one JSON-encoded redrawEvent per line for as long as the connection
+// stays open. handleConn's deferred Close and our deferred unsubscribe
+// clean everything up once it returns.
+func (s *ipcServer) streamEvents(conn net.Conn, hub *redrawHub, drawerNames []string) {
+	sub := hub.subscribe()
+	defer hub.unsubscribe(sub)
+
+	// A subscriber has nothing further to send once it asks to
+	// subscribe, so the only way to notice it disconnected during a
+	// quiet period (no redraws firing) is to keep reading from it:
+	// any read erroring out, EOF on a clean close included, means the
+	// peer is gone.
+	closed := make(chan struct{})
+	go func() {
+		ioutil.ReadAll(conn)
+		close(closed)
+	}()
+
+	enc := json.NewEncoder(conn)
+	for {
+		select {
+		case <-closed:
+			return
+		case <-sub.trigger:
+			for idx := range sub.take() {
+				if idx < 0 || idx >= len(drawerNames) {
+					continue
+				}
+				if err := enc.Encode(redrawEvent{Event: "redraw", Plugin: drawerNames[idx]}); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Close stops the control socket from accepting new connections.
+func (s *ipcServer) Close() error {
+	return s.ln.Close()
+}
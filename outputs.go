@@ -0,0 +1,215 @@
+package quobar
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/randr"
+	"github.com/BurntSushi/xgb/xinerama"
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+// outputInfo describes the geometry of a single connected output (a
+// RandR output, a Xinerama screen, or the whole root window), as
+// needed to size and position a status bar on it. output is only set
+// for RandR outputs.
+type outputInfo struct {
+	output                    randr.Output
+	name                      string
+	x                         int16
+	y                         int16
+	screenHeightInPixels      uint16
+	screenWidthInPixels       uint16
+	screenHeightInMillimeters uint32
+}
+
+var errUnplugged = errors.New("display is not connected")
+
+// errNoMatchingOutputs is returned by findOutputs/findXineramaOutputs
+// instead of their generic "nothing connected" error when at least one
+// output was actually plugged in but Config.Outputs filtered all of
+// them out. discoverOutputs treats this as a configuration error
+// rather than a reason to fall back further, so a typo'd or stale
+// allowlist entry doesn't silently default to a bar spanning the
+// whole root window.
+var errNoMatchingOutputs = errors.New("no connected output matches Config.Outputs")
+
+func getOutput(X *xgb.Conn, configTimestamp xproto.Timestamp, output randr.Output) (*outputInfo, error) {
+	randrOutput, err := randr.GetOutputInfo(X, output, configTimestamp).Reply()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get RandR screen resources: %v", err)
+	}
+
+	// is there a more direct way to detect unplugged monitors?
+	if randrOutput.MmHeight == 0 {
+		return nil, errUnplugged
+	}
+
+	randrCrtcInfo, err := randr.GetCrtcInfo(X, randrOutput.Crtc, configTimestamp).Reply()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get RandR monitor info: %v", err)
+	}
+
+	info := &outputInfo{
+		output:                    output,
+		name:                      string(randrOutput.Name),
+		x:                         randrCrtcInfo.X,
+		y:                         randrCrtcInfo.Y,
+		screenHeightInPixels:      randrCrtcInfo.Height,
+		screenWidthInPixels:       randrCrtcInfo.Width,
+		screenHeightInMillimeters: randrOutput.MmHeight,
+	}
+	return info, nil
+}
+
+// findOutputs enumerates every RandR output on screen and returns the
+// outputInfo for each one that currently has a monitor plugged in,
+// primary output first. If allow is non-empty, outputs whose name is
+// not in allow are skipped, letting Config.Outputs restrict bars to a
+// subset of connected displays.
+func findOutputs(X *xgb.Conn, screen *xproto.ScreenInfo, allow []string) ([]*outputInfo, error) {
+	randrScreenResources, err := randr.GetScreenResourcesCurrent(X, screen.Root).Reply()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get RandR screen resources: %v", err)
+	}
+
+	randrPrimary, err := randr.GetOutputPrimary(X, screen.Root).Reply()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get RandR primary: %v", err)
+	}
+
+	outputs := make([]randr.Output, 0, len(randrScreenResources.Outputs))
+	if randrPrimary.Output != 0 {
+		outputs = append(outputs, randrPrimary.Output)
+	}
+	for _, output := range randrScreenResources.Outputs {
+		if output == randrPrimary.Output {
+			continue
+		}
+		outputs = append(outputs, output)
+	}
+
+	var infos []*outputInfo
+	connected := 0
+	for _, output := range outputs {
+		info, err := getOutput(X, randrScreenResources.ConfigTimestamp, output)
+		if err == errUnplugged {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		connected++
+		if len(allow) > 0 && !stringIn(info.name, allow) {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	if len(infos) == 0 {
+		if len(allow) > 0 && connected > 0 {
+			return nil, errNoMatchingOutputs
+		}
+		return nil, errors.New("cannot find any plugged-in output")
+	}
+	return infos, nil
+}
+
+func stringIn(s string, list []string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// discoverOutputs finds the geometry of every display to put a bar
+// on. It prefers RandR, which is what lets Main hot-plug bars as
+// monitors come and go, but falls back to Xinerama.QueryScreens on
+// servers where RandR is absent or broken (some nested Xephyr and VNC
+// setups), and finally to the root window's own geometry as a single
+// output. The returned bool reports whether RandR is usable, so Main
+// knows whether to register for hot-plug notifications.
+//
+// A non-empty allow that doesn't match any actually-connected output
+// is a configuration error, not a reason to keep falling back: it
+// returns an error instead of silently trying Xinerama, then the root
+// window (which doesn't consult allow at all), under a name the user
+// never asked for.
+func discoverOutputs(X *xgb.Conn, screen *xproto.ScreenInfo, allow []string) ([]*outputInfo, bool, error) {
+	if err := randr.Init(X); err == nil {
+		infos, err := findOutputs(X, screen, allow)
+		if err == nil {
+			return infos, true, nil
+		}
+		if err == errNoMatchingOutputs {
+			return nil, false, fmt.Errorf("choosing monitors via RandR: %v", err)
+		}
+	}
+
+	if err := xinerama.Init(X); err == nil {
+		infos, err := findXineramaOutputs(X, screen, allow)
+		if err == nil {
+			return infos, false, nil
+		}
+		if err == errNoMatchingOutputs {
+			return nil, false, fmt.Errorf("choosing monitors via Xinerama: %v", err)
+		}
+	}
+
+	if len(allow) > 0 {
+		return nil, false, fmt.Errorf("choosing monitors for the root-geometry fallback: %v", errNoMatchingOutputs)
+	}
+
+	return []*outputInfo{rootOutput(screen)}, false, nil
+}
+
+// findXineramaOutputs enumerates screens via the Xinerama extension.
+// Xinerama doesn't report a screen's physical size, so the root
+// window's millimeter height is used for all of them; this affects
+// DPI-derived sizing, including the bar height newBar computes (and,
+// through it, a bottom-docked bar's y), but not the screen's origin or
+// width.
+func findXineramaOutputs(X *xgb.Conn, screen *xproto.ScreenInfo, allow []string) ([]*outputInfo, error) {
+	reply, err := xinerama.QueryScreens(X).Reply()
+	if err != nil {
+		return nil, fmt.Errorf("querying Xinerama screens: %v", err)
+	}
+
+	var infos []*outputInfo
+	connected := 0
+	for idx, s := range reply.ScreenInfo {
+		connected++
+		name := fmt.Sprintf("xinerama-%d", idx)
+		if len(allow) > 0 && !stringIn(name, allow) {
+			continue
+		}
+		infos = append(infos, &outputInfo{
+			name:                      name,
+			x:                         s.XOrg,
+			y:                         s.YOrg,
+			screenWidthInPixels:       uint16(s.Width),
+			screenHeightInPixels:      uint16(s.Height),
+			screenHeightInMillimeters: uint32(screen.HeightInMillimeters),
+		})
+	}
+	if len(infos) == 0 {
+		if len(allow) > 0 && connected > 0 {
+			return nil, errNoMatchingOutputs
+		}
+		return nil, errors.New("cannot find any Xinerama screen")
+	}
+	return infos, nil
+}
+
+// rootOutput treats the whole root window as a single output, for
+// servers that have neither RandR nor Xinerama.
+func rootOutput(screen *xproto.ScreenInfo) *outputInfo {
+	return &outputInfo{
+		name:                      "root",
+		screenWidthInPixels:       screen.WidthInPixels,
+		screenHeightInPixels:      screen.HeightInPixels,
+		screenHeightInMillimeters: uint32(screen.HeightInMillimeters),
+	}
+}
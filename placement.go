@@ -0,0 +1,75 @@
+package quobar
+
+import (
+	"image"
+
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgbutil/ewmh"
+)
+
+// Position selects where Main docks each bar within its output.
+type Position int
+
+const (
+	// PositionBottom docks the bar along the bottom edge of its
+	// output and reserves a bottom strut, the original (and still
+	// default) behavior.
+	PositionBottom Position = iota
+	// PositionTop docks the bar along the top edge of its output and
+	// reserves a top strut.
+	PositionTop
+	// PositionFloating places the bar at Config.Margin's offsets
+	// without reserving any strut, so other windows can occupy the
+	// space behind it.
+	PositionFloating
+)
+
+// Margin sets gaps around a bar, in pixels, independent per edge. It
+// applies regardless of Position: for Top/Bottom it insets the bar
+// from the sides of its output and from the docked edge; for Floating
+// it is the bar's only positioning.
+type Margin struct {
+	Top, Right, Bottom, Left int
+}
+
+// barGeometry computes the window rectangle for a bar of the given
+// height docked to info according to position and margin.
+func barGeometry(info *outputInfo, position Position, margin Margin, height int) image.Rectangle {
+	x := int(info.x) + margin.Left
+	width := int(info.screenWidthInPixels) - margin.Left - margin.Right
+
+	var y int
+	switch position {
+	case PositionTop, PositionFloating:
+		y = int(info.y) + margin.Top
+	case PositionBottom:
+		y = int(info.y) + int(info.screenHeightInPixels) - height - margin.Bottom
+	}
+
+	return image.Rect(x, y, x+width, y+height)
+}
+
+// barStrut builds the partial strut to reserve for a bar occupying
+// geom on screen, scoped to geom's horizontal span via StartX/EndX so
+// a multi-monitor setup doesn't reserve space across the whole root
+// window. Strut distances are measured from the edges of the root
+// window's screen, per the _NET_WM_STRUT_PARTIAL spec, not from the
+// bar's own output. PositionFloating reserves no strut at all.
+func barStrut(screen *xproto.ScreenInfo, position Position, geom image.Rectangle) *ewmh.WmStrutPartial {
+	switch position {
+	case PositionTop:
+		return &ewmh.WmStrutPartial{
+			Top:       uint(geom.Max.Y),
+			TopStartX: uint(geom.Min.X),
+			TopEndX:   uint(geom.Max.X),
+		}
+	case PositionBottom:
+		return &ewmh.WmStrutPartial{
+			Bottom:       uint(int(screen.HeightInPixels) - geom.Min.Y),
+			BottomStartX: uint(geom.Min.X),
+			BottomEndX:   uint(geom.Max.X),
+		}
+	default: // PositionFloating
+		return &ewmh.WmStrutPartial{}
+	}
+}
@@ -0,0 +1,85 @@
+package quobar
+
+import (
+	"image"
+	"testing"
+
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgbutil/ewmh"
+)
+
+func TestBarGeometry(t *testing.T) {
+	info := &outputInfo{
+		x: 100, y: 200,
+		screenWidthInPixels:  1000,
+		screenHeightInPixels: 800,
+	}
+
+	tests := []struct {
+		name     string
+		position Position
+		margin   Margin
+		height   int
+		want     image.Rectangle
+	}{
+		{
+			name:     "bottom, no margin",
+			position: PositionBottom,
+			height:   30,
+			want:     image.Rect(100, 970, 1100, 1000),
+		},
+		{
+			name:     "bottom, with margin",
+			position: PositionBottom,
+			margin:   Margin{Top: 1, Right: 10, Bottom: 20, Left: 5},
+			height:   30,
+			// width shrinks by Left+Right; the bar is inset from the
+			// bottom edge by margin.Bottom, not centered on height.
+			want: image.Rect(105, 950, 1090, 980),
+		},
+		{
+			name:     "top, with margin",
+			position: PositionTop,
+			margin:   Margin{Top: 5, Right: 10, Bottom: 20, Left: 5},
+			height:   30,
+			want:     image.Rect(105, 205, 1090, 235),
+		},
+		{
+			name:     "floating, margin is the only positioning",
+			position: PositionFloating,
+			margin:   Margin{Top: 5, Right: 10, Bottom: 20, Left: 5},
+			height:   30,
+			want:     image.Rect(105, 205, 1090, 235),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := barGeometry(info, tt.position, tt.margin, tt.height)
+			if got != tt.want {
+				t.Errorf("barGeometry(%v, %v, height=%d) = %v, want %v", tt.position, tt.margin, tt.height, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBarStrut(t *testing.T) {
+	screen := &xproto.ScreenInfo{HeightInPixels: 800}
+
+	topGeom := image.Rect(100, 0, 900, 30)
+	top := barStrut(screen, PositionTop, topGeom)
+	if top.Top != 30 || top.TopStartX != 100 || top.TopEndX != 900 {
+		t.Errorf("barStrut(Top) = %+v, want Top=30 TopStartX=100 TopEndX=900", top)
+	}
+
+	bottomGeom := image.Rect(100, 770, 900, 800)
+	bottom := barStrut(screen, PositionBottom, bottomGeom)
+	if bottom.Bottom != 30 || bottom.BottomStartX != 100 || bottom.BottomEndX != 900 {
+		t.Errorf("barStrut(Bottom) = %+v, want Bottom=30 BottomStartX=100 BottomEndX=900", bottom)
+	}
+
+	floating := barStrut(screen, PositionFloating, topGeom)
+	if *floating != (ewmh.WmStrutPartial{}) {
+		t.Errorf("barStrut(Floating) = %+v, want zero value", floating)
+	}
+}
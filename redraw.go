@@ -0,0 +1,192 @@
+package quobar
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultMaxRefreshRate is used when Config.MaxRefreshRate is zero.
+const defaultMaxRefreshRate = 30 // Hz
+
+// refreshRate returns configured if it's set, falling back to
+// defaultMaxRefreshRate otherwise.
+func refreshRate(configured float64) float64 {
+	if configured <= 0 {
+		return defaultMaxRefreshRate
+	}
+	return configured
+}
+
+// NotifyDrawer is an optional interface a Drawer can implement to ask
+// for a redraw only when its own displayed state actually changes,
+// instead of being redrawn on a fixed polling interval.
+type NotifyDrawer interface {
+	Drawer
+	// NotifyCh returns a channel that the plugin sends on whenever its
+	// content has changed and it needs to be redrawn. The channel is
+	// read for as long as the bar runs; closing it simply stops that
+	// plugin from requesting redraws.
+	NotifyCh() <-chan struct{}
+}
+
+// redrawSubscription delivers the dirty-drawer-index sets one bar
+// cares about, coalesced between reads. A drawer instance shared
+// across several bars (see chunk0-1: one bar per output, same
+// plugins) has exactly one NotifyCh, so redrawHub fans each of its
+// notifications out to every bar's own subscription instead of
+// letting a single bar drain it.
+type redrawSubscription struct {
+	mu      sync.Mutex
+	dirty   map[int]struct{}
+	trigger chan struct{}
+}
+
+func newRedrawSubscription() *redrawSubscription {
+	return &redrawSubscription{
+		dirty:   make(map[int]struct{}),
+		trigger: make(chan struct{}, 1),
+	}
+}
+
+func (s *redrawSubscription) mark(idx int) {
+	s.mu.Lock()
+	s.dirty[idx] = struct{}{}
+	s.mu.Unlock()
+
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+		// a flush is already pending
+	}
+}
+
+// take returns the subscription's current dirty set and clears it.
+func (s *redrawSubscription) take() map[int]struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dirty := s.dirty
+	s.dirty = make(map[int]struct{})
+	return dirty
+}
+
+// redrawHub drains the NotifyCh of every drawer that implements
+// NotifyDrawer exactly once each, and broadcasts each notification to
+// every subscriber. One hub is shared by all of a Main invocation's
+// bars, so a plugin visible on several monitors redraws on all of
+// them, not just whichever bar's goroutine happened to receive the
+// single underlying channel send.
+type redrawHub struct {
+	mu   sync.Mutex
+	subs map[*redrawSubscription]struct{}
+}
+
+// newRedrawHub starts the draining goroutines and returns the hub
+// ready for bars to subscribe to.
+func newRedrawHub(drawers []Drawer) *redrawHub {
+	h := &redrawHub{subs: make(map[*redrawSubscription]struct{})}
+	for idx, d := range drawers {
+		nd, ok := d.(NotifyDrawer)
+		if !ok {
+			continue
+		}
+		go func(idx int, nd NotifyDrawer) {
+			for range nd.NotifyCh() {
+				h.broadcast(idx)
+			}
+		}(idx, nd)
+	}
+	return h
+}
+
+func (h *redrawHub) broadcast(idx int) {
+	h.mu.Lock()
+	subs := make([]*redrawSubscription, 0, len(h.subs))
+	for s := range h.subs {
+		subs = append(subs, s)
+	}
+	h.mu.Unlock()
+
+	for _, s := range subs {
+		s.mark(idx)
+	}
+}
+
+// subscribe registers a new listener. The caller must call
+// unsubscribe once it's done (e.g. when its bar closes) to stop
+// receiving broadcasts.
+func (h *redrawHub) subscribe() *redrawSubscription {
+	s := newRedrawSubscription()
+	h.mu.Lock()
+	h.subs[s] = struct{}{}
+	h.mu.Unlock()
+	return s
+}
+
+func (h *redrawHub) unsubscribe(s *redrawSubscription) {
+	h.mu.Lock()
+	delete(h.subs, s)
+	h.mu.Unlock()
+}
+
+// newRedrawScheduler reads sub's notifications and returns a channel
+// of dirty-drawer index sets, coalesced so that a burst of
+// notifications produces at most one send per 1/maxRate seconds. It
+// stops once stop is closed.
+func newRedrawScheduler(sub *redrawSubscription, maxRate float64, stop <-chan struct{}) <-chan map[int]struct{} {
+	minInterval := time.Duration(float64(time.Second) / maxRate)
+	out := make(chan map[int]struct{})
+	go func() {
+		var last time.Time
+		for {
+			select {
+			case <-stop:
+				return
+			case <-sub.trigger:
+				if wait := minInterval - time.Since(last); wait > 0 {
+					time.Sleep(wait)
+				}
+				last = time.Now()
+				select {
+				case out <- sub.take():
+				case <-stop:
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// periodicDrawer adapts a Drawer with no natural change notification
+// (a clock, say) to NotifyDrawer, by firing its NotifyCh once per
+// interval.
+type periodicDrawer struct {
+	Drawer
+	ch chan struct{}
+}
+
+// PeriodicDrawer wraps d so the event-driven scheduler redraws it once
+// per interval. Use this for plugins whose content changes on a timer
+// rather than in response to some external event.
+func PeriodicDrawer(d Drawer, interval time.Duration) Drawer {
+	pd := &periodicDrawer{
+		Drawer: d,
+		ch:     make(chan struct{}, 1),
+	}
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for range t.C {
+			select {
+			case pd.ch <- struct{}{}:
+			default:
+				// a redraw is already pending
+			}
+		}
+	}()
+	return pd
+}
+
+func (p *periodicDrawer) NotifyCh() <-chan struct{} {
+	return p.ch
+}
@@ -0,0 +1,81 @@
+package quobar
+
+import (
+	"image"
+	"image/draw"
+	"testing"
+	"time"
+)
+
+func TestDrawerRect(t *testing.T) {
+	bounds := image.Rect(0, 0, 100, 20)
+
+	tests := []struct {
+		n, idx int
+		want   image.Rectangle
+	}{
+		{n: 2, idx: 0, want: image.Rect(0, 0, 50, 20)},
+		{n: 2, idx: 1, want: image.Rect(50, 0, 100, 20)},
+		{n: 4, idx: 2, want: image.Rect(50, 0, 75, 20)},
+	}
+
+	for _, tt := range tests {
+		got := drawerRect(bounds, tt.n, tt.idx)
+		if got != tt.want {
+			t.Errorf("drawerRect(%v, %d, %d) = %v, want %v", bounds, tt.n, tt.idx, got, tt.want)
+		}
+	}
+}
+
+// notifyingDrawer is a minimal NotifyDrawer for exercising redrawHub
+// without any X11 state.
+type notifyingDrawer struct {
+	ch chan struct{}
+}
+
+func (d *notifyingDrawer) Draw(img draw.Image) error { return nil }
+func (d *notifyingDrawer) NotifyCh() <-chan struct{} { return d.ch }
+
+func TestRedrawHubFansOutToEverySubscriber(t *testing.T) {
+	// Regression test for chunk0-2: a NotifyDrawer shared across
+	// several bars must wake every subscriber, not just whichever one
+	// happened to receive the single underlying channel send.
+	nd := &notifyingDrawer{ch: make(chan struct{}, 1)}
+	hub := newRedrawHub([]Drawer{nd})
+
+	const n = 3
+	subs := make([]*redrawSubscription, n)
+	for i := range subs {
+		subs[i] = hub.subscribe()
+	}
+
+	nd.ch <- struct{}{}
+
+	for i, sub := range subs {
+		select {
+		case <-sub.trigger:
+		case <-time.After(time.Second):
+			t.Fatalf("subscriber %d never saw the redraw notification", i)
+		}
+		dirty := sub.take()
+		if _, ok := dirty[0]; !ok || len(dirty) != 1 {
+			t.Errorf("subscriber %d dirty set = %v, want {0}", i, dirty)
+		}
+	}
+}
+
+func TestRedrawHubUnsubscribeStopsDelivery(t *testing.T) {
+	nd := &notifyingDrawer{ch: make(chan struct{}, 1)}
+	hub := newRedrawHub([]Drawer{nd})
+
+	sub := hub.subscribe()
+	hub.unsubscribe(sub)
+
+	nd.ch <- struct{}{}
+
+	select {
+	case <-sub.trigger:
+		t.Fatal("unsubscribed subscription still received a notification")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
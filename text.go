@@ -0,0 +1,75 @@
+package quobar
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// TextDrawer is a Drawer whose content is set purely over IPC (see
+// ipc.go) rather than computed from local system state. It mirrors
+// the i3blocks/lemonbar/dwm convention of external status feeders, so
+// users can script bar content from shell or systemd units without
+// writing a Go plugin.
+type TextDrawer struct {
+	mu     sync.Mutex
+	text   string
+	notify chan struct{}
+}
+
+// NewTextDrawer returns a TextDrawer plugin with empty initial
+// content; its text is set later via the control socket.
+func NewTextDrawer(state *State) (Drawer, error) {
+	return &TextDrawer{
+		notify: make(chan struct{}, 1),
+	}, nil
+}
+
+// Set replaces the drawer's text and requests a redraw.
+func (t *TextDrawer) Set(text string) {
+	t.mu.Lock()
+	t.text = text
+	t.mu.Unlock()
+
+	select {
+	case t.notify <- struct{}{}:
+	default:
+		// a redraw is already pending
+	}
+}
+
+// NotifyCh implements NotifyDrawer: it fires after each call to Set,
+// whether or not the new text differs from the old.
+func (t *TextDrawer) NotifyCh() <-chan struct{} {
+	return t.notify
+}
+
+func (t *TextDrawer) Draw(img draw.Image) error {
+	t.mu.Lock()
+	text := t.text
+	t.mu.Unlock()
+
+	bounds := img.Bounds()
+	draw.Draw(img, bounds, image.NewUniform(color.Transparent), image.ZP, draw.Src)
+
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(color.Black),
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(bounds.Min.X, bounds.Min.Y+bounds.Dy()/2+4),
+	}
+	d.DrawString(text)
+	return nil
+}
+
+func init() {
+	plugins["text"] = plugin{
+		first: true,
+		New:   NewTextDrawer,
+	}
+}